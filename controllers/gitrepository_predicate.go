@@ -17,6 +17,7 @@ limitations under the License.
 package controllers
 
 import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
@@ -24,7 +25,9 @@ import (
 )
 
 // GitRepositoryRevisionChangePredicate triggers an update event
-// when a GitRepository revision changes.
+// when a GitRepository revision changes. Events of suspended
+// GitRepositories are ignored, and resuming a GitRepository
+// triggers an event to process its current artifact.
 type GitRepositoryRevisionChangePredicate struct {
 	predicate.Funcs
 }
@@ -36,6 +39,10 @@ func (GitRepositoryRevisionChangePredicate) Create(e event.CreateEvent) bool {
 		return false
 	}
 
+	if isSuspended(e.Object) {
+		return false
+	}
+
 	return true
 }
 
@@ -54,6 +61,15 @@ func (GitRepositoryRevisionChangePredicate) Update(e event.UpdateEvent) bool {
 		return false
 	}
 
+	if isSuspended(e.ObjectNew) {
+		return false
+	}
+
+	// catch up on the artifact that was skipped while suspended
+	if isSuspended(e.ObjectOld) && newSource.GetArtifact() != nil {
+		return true
+	}
+
 	if oldSource.GetArtifact() == nil && newSource.GetArtifact() != nil {
 		return true
 	}
@@ -65,3 +81,8 @@ func (GitRepositoryRevisionChangePredicate) Update(e event.UpdateEvent) bool {
 
 	return false
 }
+
+func isSuspended(obj client.Object) bool {
+	repository, ok := obj.(*sourcev1.GitRepository)
+	return ok && repository.Spec.Suspend
+}
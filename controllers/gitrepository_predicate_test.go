@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestGitRepositoryRevisionChangePredicate_Create(t *testing.T) {
+	tests := []struct {
+		name      string
+		artifact  *sourcev1.Artifact
+		suspended bool
+		want      bool
+	}{
+		{
+			name:     "active with artifact",
+			artifact: &sourcev1.Artifact{Revision: "main@sha1:a"},
+			want:     true,
+		},
+		{
+			name:      "suspended with artifact",
+			artifact:  &sourcev1.Artifact{Revision: "main@sha1:a"},
+			suspended: true,
+			want:      false,
+		},
+		{
+			name: "active without artifact",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			repository := newGitRepository("podinfo", tt.artifact)
+			repository.Spec.Suspend = tt.suspended
+
+			got := GitRepositoryRevisionChangePredicate{}.Create(event.CreateEvent{Object: repository})
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestGitRepositoryRevisionChangePredicate_Update(t *testing.T) {
+	tests := []struct {
+		name         string
+		oldRevision  string
+		newRevision  string
+		oldSuspended bool
+		suspended    bool
+		want         bool
+	}{
+		{
+			name:        "suspended with revision change",
+			oldRevision: "main@sha1:a",
+			newRevision: "main@sha1:b",
+			suspended:   true,
+			want:        false,
+		},
+		{
+			name:        "active with revision change",
+			oldRevision: "main@sha1:a",
+			newRevision: "main@sha1:b",
+			want:        true,
+		},
+		{
+			name:        "active without revision change",
+			oldRevision: "main@sha1:a",
+			newRevision: "main@sha1:a",
+			want:        false,
+		},
+		{
+			name:         "resumed without revision change",
+			oldRevision:  "main@sha1:a",
+			newRevision:  "main@sha1:a",
+			oldSuspended: true,
+			want:         true,
+		},
+		{
+			name:         "resumed with revision change",
+			oldRevision:  "main@sha1:a",
+			newRevision:  "main@sha1:b",
+			oldSuspended: true,
+			want:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			oldRepository := newGitRepository("podinfo", &sourcev1.Artifact{Revision: tt.oldRevision})
+			newRepository := newGitRepository("podinfo", &sourcev1.Artifact{Revision: tt.newRevision})
+			oldRepository.Spec.Suspend = tt.suspended || tt.oldSuspended
+			newRepository.Spec.Suspend = tt.suspended
+
+			got := GitRepositoryRevisionChangePredicate{}.Update(event.UpdateEvent{
+				ObjectOld: oldRepository,
+				ObjectNew: newRepository,
+			})
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
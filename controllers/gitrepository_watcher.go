@@ -18,9 +18,14 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,49 +35,102 @@ import (
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 )
 
+// tmpDirPrefix is the prefix of the temp dirs artifacts are extracted to.
+const tmpDirPrefix = "source-watcher-"
+
 // GitRepositoryWatcher watches GitRepository objects for revision changes
 type GitRepositoryWatcher struct {
 	client.Client
-	artifactFetcher *fetch.ArchiveFetcher
-	HttpRetry       int
+	artifactFetcher      *fetch.ArchiveFetcher
+	HttpRetry            int
+	KeepWorkDirOnFailure bool
 }
 
 func (r *GitRepositoryWatcher) SetupWithManager(mgr ctrl.Manager) error {
-	r.artifactFetcher = fetch.New(
+	r.artifactFetcher = r.newArtifactFetcher()
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&sourcev1.GitRepository{}, builder.WithPredicates(GitRepositoryRevisionChangePredicate{})).
+		Complete(r)
+}
+
+// ReconcileOnce fetches and processes the artifact of the given GitRepository
+// without a manager, e.g. to test a setup from a CI pipeline.
+// Unlike Reconcile, it fails if the GitRepository or its artifact is missing.
+func (r *GitRepositoryWatcher) ReconcileOnce(ctx context.Context, name types.NamespacedName) error {
+	r.artifactFetcher = r.newArtifactFetcher()
+
+	var repository sourcev1.GitRepository
+	if err := r.Get(ctx, name, &repository); err != nil {
+		return err
+	}
+
+	if repository.Status.Artifact == nil {
+		return fmt.Errorf("GitRepository %s has no artifact", name)
+	}
+
+	_, err := r.reconcile(ctx, &repository)
+	return err
+}
+
+func (r *GitRepositoryWatcher) newArtifactFetcher() *fetch.ArchiveFetcher {
+	return fetch.New(
 		fetch.WithRetries(r.HttpRetry),
 		fetch.WithMaxDownloadSize(tar.UnlimitedUntarSize),
 		fetch.WithUntar(tar.WithMaxUntarSize(tar.UnlimitedUntarSize)),
 		fetch.WithHostnameOverwrite(os.Getenv("SOURCE_CONTROLLER_LOCALHOST")),
 		fetch.WithLogger(nil),
 	)
-
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&sourcev1.GitRepository{}, builder.WithPredicates(GitRepositoryRevisionChangePredicate{})).
-		Complete(r)
 }
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories,verbs=get;list;watch
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories/status,verbs=get
 
 func (r *GitRepositoryWatcher) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	log := ctrl.LoggerFrom(ctx)
-
 	// get source object
 	var repository sourcev1.GitRepository
 	if err := r.Get(ctx, req.NamespacedName, &repository); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	return r.reconcile(ctx, &repository)
+}
+
+// reconcile fetches and processes the artifact of the given GitRepository.
+func (r *GitRepositoryWatcher) reconcile(ctx context.Context, repository *sourcev1.GitRepository) (result ctrl.Result, retErr error) {
+	log := ctrl.LoggerFrom(ctx)
+
 	artifact := repository.Status.Artifact
 	log.Info("New revision detected", "revision", artifact.Revision)
 
+	// refuse to fetch artifacts that can't be verified
+	if artifact.Digest == "" {
+		return ctrl.Result{}, fmt.Errorf("artifact for revision %s has no digest", artifact.Revision)
+	}
+
 	// create tmp dir
-	tmpDir, err := os.MkdirTemp("", repository.Name)
+	tmpDir, err := os.MkdirTemp("", tmpDirPattern(repository))
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to create temp dir, error: %w", err)
 	}
 
 	defer func(path string) {
+		if r.KeepWorkDirOnFailure {
+			// only keep the latest failed attempt to bound disk usage,
+			// and none once the GitRepository has recovered
+			keep := ""
+			if retErr != nil {
+				keep = path
+			}
+			if err := removeTempDirs(repository, keep); err != nil {
+				log.Error(err, "unable to remove temp dirs")
+			}
+			if keep != "" {
+				log.Info("Keeping temp dir after failure", "path", path)
+			}
+			return
+		}
+
 		err := os.RemoveAll(path)
 		if err != nil {
 			log.Error(err, "unable to remove temp dir")
@@ -80,11 +138,24 @@ func (r *GitRepositoryWatcher) Reconcile(ctx context.Context, req ctrl.Request)
 	}(tmpDir)
 
 	// download and extract artifact
-	if err := r.artifactFetcher.Fetch(artifact.URL, artifact.Digest, tmpDir); err != nil {
-		log.Error(err, "unable to fetch artifact")
+	fetchStart := time.Now()
+	err = r.artifactFetcher.FetchWithContext(ctx, artifact.URL, artifact.Digest, tmpDir)
+	fetchDuration := time.Since(fetchStart)
+	sourceFetchDuration.WithLabelValues(sourcev1.GitRepositoryKind, repository.Name, repository.Namespace).
+		Observe(fetchDuration.Seconds())
+	if err != nil {
+		log.Error(err, "unable to fetch artifact", "duration", fetchDuration.String())
 		return ctrl.Result{}, err
 	}
 
+	if debugLog := log.V(1); debugLog.Enabled() {
+		size, err := dirSize(tmpDir)
+		if err != nil {
+			log.Error(err, "unable to compute artifact size")
+		}
+		debugLog.Info("Artifact fetched", "duration", fetchDuration.String(), "size", size)
+	}
+
 	// list artifact content
 	files, err := os.ReadDir(tmpDir)
 	if err != nil {
@@ -98,3 +169,89 @@ func (r *GitRepositoryWatcher) Reconcile(ctx context.Context, req ctrl.Request)
 
 	return ctrl.Result{}, nil
 }
+
+// tmpDirPattern returns the os.MkdirTemp pattern of the temp dirs
+// created for the given GitRepository. Names and namespaces can't
+// contain underscores, which keeps the patterns of different
+// GitRepositories from matching each other.
+func tmpDirPattern(repository *sourcev1.GitRepository) string {
+	return fmt.Sprintf("%s%s_%s_", tmpDirPrefix, repository.Namespace, repository.Name)
+}
+
+// removeTempDirs removes the temp dirs created for the given
+// GitRepository, except for keep.
+func removeTempDirs(repository *sourcev1.GitRepository, keep string) error {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), tmpDirPattern(repository)+"*"))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, dir := range dirs {
+		if dir == keep {
+			continue
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RemoveStaleTempDirs removes the temp dirs left behind by previous runs
+// of the controller, e.g. after a crash, that are older than maxAge.
+func RemoveStaleTempDirs(maxAge time.Duration) error {
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		return fmt.Errorf("failed to list temp dirs, error: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tmpDirPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(os.TempDir(), entry.Name())); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// dirSize returns the total size in bytes of the regular files under path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
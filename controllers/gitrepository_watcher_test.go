@@ -0,0 +1,284 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestGitRepositoryWatcher_ReconcileEmptyDigest(t *testing.T) {
+	g := NewWithT(t)
+	t.Setenv("TMPDIR", t.TempDir())
+
+	repository := newGitRepository("podinfo", &sourcev1.Artifact{
+		URL:      "http://source-controller/podinfo.tar.gz",
+		Revision: "main@sha1:0123456789abcdef",
+	})
+	r := newTestWatcher(g, repository)
+
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(repository)})
+	g.Expect(err).To(MatchError(ContainSubstring("has no digest")))
+	g.Expect(tempDirs(g, repository)).To(BeEmpty())
+}
+
+func TestGitRepositoryWatcher_ReconcileOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository func(t *testing.T) *sourcev1.GitRepository
+		wantErr    string
+	}{
+		{
+			name: "missing GitRepository",
+			repository: func(t *testing.T) *sourcev1.GitRepository {
+				return nil
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "GitRepository without artifact",
+			repository: func(t *testing.T) *sourcev1.GitRepository {
+				return newGitRepository("podinfo", nil)
+			},
+			wantErr: "has no artifact",
+		},
+		{
+			name: "GitRepository with artifact",
+			repository: func(t *testing.T) *sourcev1.GitRepository {
+				return newGitRepository("podinfo", serveArtifact(t, map[string]string{
+					"deploy/podinfo.yaml": "kind: Deployment",
+				}))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			t.Setenv("TMPDIR", t.TempDir())
+
+			var objects []client.Object
+			if repository := tt.repository(t); repository != nil {
+				objects = append(objects, repository)
+			}
+			r := newTestWatcher(g, objects...)
+
+			err := r.ReconcileOnce(context.TODO(), types.NamespacedName{Namespace: "default", Name: "podinfo"})
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(tempDirs(g, newGitRepository("podinfo", nil))).To(BeEmpty())
+		})
+	}
+}
+
+func TestGitRepositoryWatcher_KeepWorkDirOnFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		keep     bool
+		fail     bool
+		wantDirs int
+	}{
+		{
+			name:     "keeps temp dir on failure",
+			keep:     true,
+			fail:     true,
+			wantDirs: 1,
+		},
+		{
+			name:     "removes temp dir on failure without flag",
+			keep:     false,
+			fail:     true,
+			wantDirs: 0,
+		},
+		{
+			name:     "removes temp dir on success",
+			keep:     true,
+			fail:     false,
+			wantDirs: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			t.Setenv("TMPDIR", t.TempDir())
+
+			artifact := serveArtifact(t, map[string]string{
+				"deploy/podinfo.yaml": "kind: Deployment",
+			})
+			if tt.fail {
+				artifact.Digest = digest.FromString("mismatch").String()
+			}
+			repository := newGitRepository("podinfo", artifact)
+			r := newTestWatcher(g, repository)
+			r.KeepWorkDirOnFailure = tt.keep
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(repository)})
+			g.Expect(err != nil).To(Equal(tt.fail))
+			g.Expect(tempDirs(g, repository)).To(HaveLen(tt.wantDirs))
+		})
+	}
+}
+
+func TestGitRepositoryWatcher_KeepWorkDirOnFailureKeepsLatest(t *testing.T) {
+	g := NewWithT(t)
+	t.Setenv("TMPDIR", t.TempDir())
+
+	artifact := serveArtifact(t, map[string]string{
+		"deploy/podinfo.yaml": "kind: Deployment",
+	})
+	artifact.Digest = digest.FromString("mismatch").String()
+	repository := newGitRepository("podinfo", artifact)
+	other := newGitRepository("podinfo-dev", artifact)
+	r := newTestWatcher(g, repository, other)
+	r.KeepWorkDirOnFailure = true
+
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(other)})
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(repository)})
+	g.Expect(err).To(HaveOccurred())
+	first := tempDirs(g, repository)
+	g.Expect(first).To(HaveLen(1))
+
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(repository)})
+	g.Expect(err).To(HaveOccurred())
+	latest := tempDirs(g, repository)
+	g.Expect(latest).To(HaveLen(1))
+	g.Expect(latest[0]).ToNot(Equal(first[0]))
+
+	g.Expect(tempDirs(g, other)).To(HaveLen(1))
+
+	// recover and expect the failed attempt to be removed
+	repository.Status.Artifact = serveArtifact(t, map[string]string{
+		"deploy/podinfo.yaml": "kind: Deployment",
+	})
+	g.Expect(r.Update(context.TODO(), repository)).To(Succeed())
+
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(repository)})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tempDirs(g, repository)).To(BeEmpty())
+	g.Expect(tempDirs(g, other)).To(HaveLen(1))
+}
+
+func TestRemoveStaleTempDirs(t *testing.T) {
+	g := NewWithT(t)
+	t.Setenv("TMPDIR", t.TempDir())
+
+	stale := filepath.Join(os.TempDir(), tmpDirPrefix+"stale-123")
+	fresh := filepath.Join(os.TempDir(), tmpDirPrefix+"fresh-456")
+	other := filepath.Join(os.TempDir(), "other-789")
+	for _, dir := range []string{stale, fresh, other} {
+		g.Expect(os.Mkdir(dir, 0o700)).To(Succeed())
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	g.Expect(os.Chtimes(stale, old, old)).To(Succeed())
+	g.Expect(os.Chtimes(other, old, old)).To(Succeed())
+
+	g.Expect(RemoveStaleTempDirs(time.Hour)).To(Succeed())
+
+	g.Expect(stale).ToNot(BeADirectory())
+	g.Expect(fresh).To(BeADirectory())
+	g.Expect(other).To(BeADirectory())
+}
+
+func newGitRepository(name string, artifact *sourcev1.Artifact) *sourcev1.GitRepository {
+	return &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Status: sourcev1.GitRepositoryStatus{
+			Artifact: artifact,
+		},
+	}
+}
+
+func newTestWatcher(g *WithT, objects ...client.Object) *GitRepositoryWatcher {
+	scheme := runtime.NewScheme()
+	g.Expect(sourcev1.AddToScheme(scheme)).To(Succeed())
+
+	r := &GitRepositoryWatcher{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+	}
+	r.artifactFetcher = r.newArtifactFetcher()
+	return r
+}
+
+// serveArtifact serves a gzipped tarball of the given files
+// and returns an artifact pointing to it.
+func serveArtifact(t *testing.T, files map[string]string) *sourcev1.Artifact {
+	t.Helper()
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		g.Expect(tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0o600,
+			Size: int64(len(content)),
+		})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(gw.Close()).To(Succeed())
+
+	data := buf.Bytes()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	return &sourcev1.Artifact{
+		URL:      server.URL + "/artifact.tar.gz",
+		Revision: "main@sha1:0123456789abcdef",
+		Digest:   digest.FromBytes(data).String(),
+	}
+}
+
+// tempDirs returns the temp dirs created for the given GitRepository.
+func tempDirs(g *WithT, repository *sourcev1.GitRepository) []string {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), tmpDirPattern(repository)+"*"))
+	g.Expect(err).ToNot(HaveOccurred())
+	return dirs
+}
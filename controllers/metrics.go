@@ -0,0 +1,37 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// sourceFetchDuration records how long it takes to download
+// and extract a source artifact.
+var sourceFetchDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "source_watcher_source_fetch_duration_seconds",
+		Help:    "The duration in seconds of fetching a source artifact.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	},
+	[]string{"kind", "name", "namespace"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(sourceFetchDuration)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestGitRepositoryWatcher_SourceFetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    bool
+		wantLog types.GomegaMatcher
+	}{
+		{
+			name: "successful fetch",
+			wantLog: And(
+				ContainSubstring(`"msg"="Artifact fetched"`),
+				ContainSubstring(`"duration"=`),
+				ContainSubstring(`"size"=16`),
+			),
+		},
+		{
+			name: "failed fetch",
+			fail: true,
+			wantLog: And(
+				ContainSubstring(`"msg"="unable to fetch artifact"`),
+				ContainSubstring(`"duration"=`),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			t.Setenv("TMPDIR", t.TempDir())
+			sourceFetchDuration.Reset()
+
+			artifact := serveArtifact(t, map[string]string{
+				"deploy/podinfo.yaml": "kind: Deployment",
+			})
+			if tt.fail {
+				artifact.Digest = digest.FromString("mismatch").String()
+			}
+			repository := newGitRepository("podinfo", artifact)
+			r := newTestWatcher(g, repository)
+
+			var logs []string
+			log := funcr.New(func(prefix, args string) {
+				logs = append(logs, args)
+			}, funcr.Options{Verbosity: 1})
+			ctx := ctrl.LoggerInto(context.TODO(), log)
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(repository)})
+			g.Expect(err != nil).To(Equal(tt.fail))
+			g.Expect(logs).To(ContainElement(tt.wantLog))
+
+			g.Expect(testutil.CollectAndCount(sourceFetchDuration, "source_watcher_source_fetch_duration_seconds")).To(Equal(1))
+
+			var metric dto.Metric
+			observer := sourceFetchDuration.WithLabelValues(sourcev1.GitRepositoryKind, repository.Name, repository.Namespace)
+			g.Expect(observer.(prometheus.Metric).Write(&metric)).To(Succeed())
+			g.Expect(metric.GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+		})
+	}
+}
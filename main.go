@@ -17,14 +17,19 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"os"
+	"strings"
+	"time"
 
 	flag "github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/fluxcd/pkg/runtime/logger"
@@ -50,6 +55,9 @@ func main() {
 		metricsAddr          string
 		enableLeaderElection bool
 		httpRetry            int
+		staleTempDirAge      time.Duration
+		reconcileOnce        string
+		keepWorkDirOnFailure bool
 		logOptions           logger.Options
 	)
 
@@ -58,11 +66,32 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.IntVar(&httpRetry, "http-retry", 9, "The maximum number of retries when failing to fetch artifacts over HTTP.")
+	flag.DurationVar(&staleTempDirAge, "stale-temp-dir-age", time.Hour,
+		"The minimum age of temp dirs left behind by previous runs for them to be removed on startup.")
+	flag.StringVar(&reconcileOnce, "reconcile-once", "",
+		"Reconcile the GitRepository with the given <namespace>/<name> once and exit, without starting the manager.")
+	flag.BoolVar(&keepWorkDirOnFailure, "keep-workdir-on-failure", false,
+		"Keep the temp dir an artifact was extracted to when its reconciliation fails, for debugging.")
 	logOptions.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(logger.NewLogger(logOptions))
 
+	if reconcileOnce != "" {
+		kubeClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client")
+			os.Exit(1)
+		}
+
+		ctx := ctrl.LoggerInto(ctrl.SetupSignalHandler(), ctrl.Log.WithName("reconcile-once"))
+		os.Exit(runReconcileOnce(ctx, kubeClient, reconcileOnce, httpRetry, keepWorkDirOnFailure))
+	}
+
+	if err := controllers.RemoveStaleTempDirs(staleTempDirAge); err != nil {
+		setupLog.Error(err, "unable to remove stale temp dirs")
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:           scheme,
 		Metrics:          metricsserver.Options{BindAddress: metricsAddr},
@@ -76,8 +105,9 @@ func main() {
 	}
 
 	if err = (&controllers.GitRepositoryWatcher{
-		Client:    mgr.GetClient(),
-		HttpRetry: httpRetry,
+		Client:               mgr.GetClient(),
+		HttpRetry:            httpRetry,
+		KeepWorkDirOnFailure: keepWorkDirOnFailure,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GitRepositoryWatcher")
 		os.Exit(1)
@@ -91,3 +121,26 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runReconcileOnce reconciles the GitRepository referenced as <namespace>/<name>
+// once and returns the exit code of the process.
+func runReconcileOnce(ctx context.Context, c client.Client, ref string, httpRetry int, keepWorkDirOnFailure bool) int {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		setupLog.Error(nil, "invalid --reconcile-once value, expected <namespace>/<name>", "value", ref)
+		return 1
+	}
+
+	watcher := &controllers.GitRepositoryWatcher{
+		Client:               c,
+		HttpRetry:            httpRetry,
+		KeepWorkDirOnFailure: keepWorkDirOnFailure,
+	}
+	if err := watcher.ReconcileOnce(ctx, types.NamespacedName{Namespace: namespace, Name: name}); err != nil {
+		setupLog.Error(err, "reconciliation failed", "gitrepository", ref)
+		return 1
+	}
+
+	setupLog.Info("reconciliation succeeded", "gitrepository", ref)
+	return 0
+}
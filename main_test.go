@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestRunReconcileOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref      string
+		artifact func(t *testing.T) *sourcev1.Artifact
+		want     int
+	}{
+		{
+			name: "missing namespace separator",
+			ref:  "podinfo",
+			want: 1,
+		},
+		{
+			name: "empty namespace",
+			ref:  "/podinfo",
+			want: 1,
+		},
+		{
+			name: "empty name",
+			ref:  "default/",
+			want: 1,
+		},
+		{
+			name: "missing GitRepository",
+			ref:  "default/other",
+			want: 1,
+		},
+		{
+			name: "GitRepository without artifact",
+			ref:  "default/podinfo",
+			want: 1,
+		},
+		{
+			name: "artifact digest mismatch",
+			ref:  "default/podinfo",
+			artifact: func(t *testing.T) *sourcev1.Artifact {
+				artifact := serveArtifact(t)
+				artifact.Digest = digest.FromString("mismatch").String()
+				return artifact
+			},
+			want: 1,
+		},
+		{
+			name:     "successful fetch",
+			ref:      "default/podinfo",
+			artifact: serveArtifact,
+			want:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			t.Setenv("TMPDIR", t.TempDir())
+
+			repository := &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "podinfo",
+					Namespace: "default",
+				},
+			}
+			if tt.artifact != nil {
+				repository.Status.Artifact = tt.artifact(t)
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(repository).Build()
+
+			g.Expect(runReconcileOnce(context.TODO(), c, tt.ref, 0, false)).To(Equal(tt.want))
+		})
+	}
+}
+
+// serveArtifact serves a gzipped tarball and returns an artifact pointing to it.
+func serveArtifact(t *testing.T) *sourcev1.Artifact {
+	t.Helper()
+	g := NewWithT(t)
+
+	content := []byte("kind: Deployment")
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	g.Expect(tw.WriteHeader(&tar.Header{
+		Name: "deploy/podinfo.yaml",
+		Mode: 0o600,
+		Size: int64(len(content)),
+	})).To(Succeed())
+	_, err := tw.Write(content)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(gw.Close()).To(Succeed())
+
+	data := buf.Bytes()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	return &sourcev1.Artifact{
+		URL:      server.URL + "/artifact.tar.gz",
+		Revision: "main@sha1:0123456789abcdef",
+		Digest:   digest.FromBytes(data).String(),
+	}
+}